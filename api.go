@@ -1,19 +1,25 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type APIServer struct {
-	listenAddr string
-	store      Storage
+	config *Config
+	store  Storage
+	mailer Mailer
 }
 
 type apiFunc func(http.ResponseWriter, *http.Request) error
@@ -37,29 +43,64 @@ func makeHTTPHandleFunc(f apiFunc) http.HandlerFunc {
 	}
 }
 
-func NewAPIServer(listenAddr string, store Storage) *APIServer {
+func NewAPIServer(config *Config, store Storage, mailer Mailer) *APIServer {
 	return &APIServer{
-		listenAddr: listenAddr,
-		store:      store,
+		config: config,
+		store:  store,
+		mailer: mailer,
 	}
 }
 
 func (s *APIServer) Run() {
 	router := mux.NewRouter()
+	router.Use(WithRequestID, WithLogging(s.config.Auth), WithRecovery)
+
 	baseRouter := router.PathPrefix("/api/v1").Subrouter()
 
 	authRouter := baseRouter.PathPrefix("/auth").Subrouter()
 	accountRouter := baseRouter.PathPrefix("/account").Subrouter()
 
+	authRouter.Use(WithAudit(s.store, s.config.Auth, false))
+	accountRouter.Use(WithAudit(s.store, s.config.Auth, true))
+
 	authRouter.HandleFunc("/sign-up", makeHTTPHandleFunc(s.handleSignUp))
 	authRouter.HandleFunc("/sign-in", makeHTTPHandleFunc(s.handleSignIn))
+	authRouter.HandleFunc("/refresh", makeHTTPHandleFunc(s.handleRefresh))
+	authRouter.HandleFunc("/sign-out", makeHTTPHandleFunc(s.handleSignOut))
+	authRouter.HandleFunc("/sign-out-all", WithJWTAuth(makeHTTPHandleFunc(s.handleSignOutAll), s.store, s.config.Auth))
+	authRouter.HandleFunc("/password-reset/request", makeHTTPHandleFunc(s.handlePasswordResetRequest))
+	authRouter.HandleFunc("/password-reset/confirm", makeHTTPHandleFunc(s.handlePasswordResetConfirm))
+
+	accountRouter.HandleFunc("/transfer", WithJWTAuth(makeHTTPHandleFunc(s.handleTransfer), s.store, s.config.Auth))
+	accountRouter.HandleFunc("/{id}/transactions", WithJWTAuth(RequireSelfOrAdmin()(makeHTTPHandleFunc(s.handleGetTransactions)), s.store, s.config.Auth))
+	accountRouter.HandleFunc("/{id}", WithJWTAuth(RequireSelfOrAdmin()(makeHTTPHandleFunc(s.handleAccountID)), s.store, s.config.Auth))
+	accountRouter.HandleFunc("", WithJWTAuth(RequireRole("admin")(makeHTTPHandleFunc(s.handleAccount)), s.store, s.config.Auth))
+
+	httpServer := &http.Server{
+		Addr:         s.config.Server.ListenAddr,
+		Handler:      router,
+		ReadTimeout:  s.config.Server.ReadTimeout,
+		WriteTimeout: s.config.Server.WriteTimeout,
+	}
+
+	go func() {
+		log.Println("Server listening on", s.config.Server.ListenAddr)
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("server error %v", err)
+		}
+	}()
 
-	accountRouter.HandleFunc("/transfer", WithJWTAuth(makeHTTPHandleFunc(s.handleTransfer), s.store))
-	accountRouter.HandleFunc("/{id}", WithJWTAuth(makeHTTPHandleFunc(s.handleAccountID), s.store))
-	accountRouter.HandleFunc("", makeHTTPHandleFunc(s.handleAccount))
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
 
-	log.Println("Server listening on", s.listenAddr)
-	http.ListenAndServe(s.listenAddr, router)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	log.Println("shutting down server")
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("graceful shutdown failed %v", err)
+	}
 }
 
 func (s *APIServer) handleSignUp(w http.ResponseWriter, r *http.Request) error {
@@ -76,7 +117,7 @@ func (s *APIServer) handleSignUp(w http.ResponseWriter, r *http.Request) error {
 		return fmt.Errorf("password and confirm password should matcn")
 	}
 
-	hashedPassword, err := hashPassword(signUpRequest.Password)
+	hashedPassword, err := hashPassword(signUpRequest.Password, s.config.Auth.BcryptCost)
 	if err != nil {
 		return fmt.Errorf("unable to create account please try again")
 	}
@@ -117,14 +158,193 @@ func (s *APIServer) handleSignIn(w http.ResponseWriter, r *http.Request) error {
 		return WriteJSON(w, http.StatusOK, APIError{Error: "Invalid Credentials!"})
 	}
 
-	token, err := CreateJWTToken(account)
+	accessToken, refreshToken, err := IssueTokenPair(s.store, account, r.UserAgent(), r.RemoteAddr, s.config.Auth)
 	if err != nil {
 		return WriteJSON(w, http.StatusOK, APIError{Error: err.Error()})
 	}
 
-	w.Header().Add("x-jwt-token", token)
+	w.Header().Add("x-jwt-token", accessToken)
+
+	return WriteJSON(w, http.StatusOK, TokenResponse{AccessToken: accessToken, RefreshToken: refreshToken})
+}
+
+func (s *APIServer) handleRefresh(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return fmt.Errorf("METHOD NOT ALLOWED %s", r.Method)
+	}
+
+	refreshReq := RefreshRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&refreshReq); err != nil {
+		return fmt.Errorf("refresh token is required")
+	}
+
+	hash := hashToken(refreshReq.RefreshToken)
+
+	stored, err := s.store.GetRefreshTokenByHash(hash)
+	if err != nil {
+		return WriteJSON(w, http.StatusUnauthorized, APIError{Error: ErrRefreshTokenInvalid.Error()})
+	}
+
+	if stored.RevokedAt != nil {
+		if err := s.store.RevokeRefreshTokensByAccount(stored.AccountID); err != nil {
+			return err
+		}
+
+		return WriteJSON(w, http.StatusUnauthorized, APIError{Error: ErrRefreshTokenReused.Error()})
+	}
+
+	if time.Now().UTC().After(stored.ExpiresAt) {
+		return WriteJSON(w, http.StatusUnauthorized, APIError{Error: ErrRefreshTokenInvalid.Error()})
+	}
+
+	// Claim the token atomically before issuing a successor pair: if two
+	// requests replay the same token concurrently, only one can win the
+	// UPDATE ... WHERE revoked_at IS NULL race, so only one successor session
+	// is ever minted.
+	claimed, err := s.store.ClaimRefreshToken(stored.ID)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		if err := s.store.RevokeRefreshTokensByAccount(stored.AccountID); err != nil {
+			return err
+		}
+
+		return WriteJSON(w, http.StatusUnauthorized, APIError{Error: ErrRefreshTokenReused.Error()})
+	}
+
+	account, err := s.store.GetAccountById(stored.AccountID)
+	if err != nil {
+		return WriteJSON(w, http.StatusUnauthorized, APIError{Error: ErrRefreshTokenInvalid.Error()})
+	}
+
+	accessToken, newRefreshToken, err := IssueTokenPair(s.store, account, r.UserAgent(), r.RemoteAddr, s.config.Auth)
+	if err != nil {
+		return err
+	}
+
+	successor, err := s.store.GetRefreshTokenByHash(hashToken(newRefreshToken))
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.SetRefreshTokenReplacedBy(stored.ID, successor.ID); err != nil {
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, TokenResponse{AccessToken: accessToken, RefreshToken: newRefreshToken})
+}
+
+func (s *APIServer) handleSignOut(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return fmt.Errorf("METHOD NOT ALLOWED %s", r.Method)
+	}
+
+	refreshReq := RefreshRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&refreshReq); err != nil {
+		return fmt.Errorf("refresh token is required")
+	}
+
+	stored, err := s.store.GetRefreshTokenByHash(hashToken(refreshReq.RefreshToken))
+	if err != nil {
+		return WriteJSON(w, http.StatusOK, "signed out")
+	}
+
+	if err := s.store.RevokeRefreshToken(stored.ID, nil); err != nil {
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, "signed out")
+}
+
+func (s *APIServer) handleSignOutAll(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return fmt.Errorf("METHOD NOT ALLOWED %s", r.Method)
+	}
+
+	accountID, err := GetAccountIDFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.RevokeRefreshTokensByAccount(accountID); err != nil {
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, "signed out from all sessions")
+}
+
+func (s *APIServer) handlePasswordResetRequest(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return fmt.Errorf("METHOD NOT ALLOWED %s", r.Method)
+	}
+
+	resetReq := PasswordResetRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&resetReq); err != nil {
+		return fmt.Errorf("email is required")
+	}
+
+	account, err := s.store.GetAccountByEmail(resetReq.Email)
+	if err == nil {
+		token, hash, err := generateOpaqueToken()
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.store.CreatePasswordReset(account.ID, hash, time.Now().UTC().Add(passwordResetTTL)); err != nil {
+			return err
+		}
+
+		body := fmt.Sprintf("Use this token to reset your password: %s\nIt expires in 30 minutes.", token)
+		if err := s.mailer.Send(account.Email, "Reset your password", body); err != nil {
+			return err
+		}
+	}
 
-	return WriteJSON(w, http.StatusOK, "signed up successfully")
+	return WriteJSON(w, http.StatusOK, "if that email is registered, a reset link has been sent")
+}
+
+func (s *APIServer) handlePasswordResetConfirm(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return fmt.Errorf("METHOD NOT ALLOWED %s", r.Method)
+	}
+
+	confirmReq := PasswordResetConfirmRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&confirmReq); err != nil {
+		return fmt.Errorf("token, new password and confirm password is required")
+	}
+
+	if confirmReq.NewPassword != confirmReq.ConfirmPassword {
+		return fmt.Errorf("new password and confirm password should matcn")
+	}
+
+	reset, err := s.store.GetPasswordResetByHash(hashToken(confirmReq.Token))
+	if err != nil {
+		return WriteJSON(w, http.StatusBadRequest, APIError{Error: ErrPasswordResetInvalid.Error()})
+	}
+
+	if reset.UsedAt != nil || time.Now().UTC().After(reset.ExpiresAt) {
+		return WriteJSON(w, http.StatusBadRequest, APIError{Error: ErrPasswordResetInvalid.Error()})
+	}
+
+	hashedPassword, err := hashPassword(confirmReq.NewPassword, s.config.Auth.BcryptCost)
+	if err != nil {
+		return fmt.Errorf("unable to reset password please try again")
+	}
+
+	if err := s.store.UpdateAccountPassword(reset.AccountID, hashedPassword); err != nil {
+		return err
+	}
+
+	if err := s.store.MarkPasswordResetUsed(reset.ID); err != nil {
+		return err
+	}
+
+	if err := s.store.RevokeRefreshTokensByAccount(reset.AccountID); err != nil {
+		return err
+	}
+
+	return WriteJSON(w, http.StatusOK, "password reset successful")
 }
 
 func (s *APIServer) handleAccount(w http.ResponseWriter, r *http.Request) error {
@@ -185,19 +405,73 @@ func (s *APIServer) handleDeleteAccount(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *APIServer) handleTransfer(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "POST" {
+		return fmt.Errorf("METHOD NOT ALLOWED %s", r.Method)
+	}
 
-	if r.Method == "POST" {
-		defer r.Body.Close()
-		transferReq := &TransferRequest{}
+	defer r.Body.Close()
+	transferReq := &TransferRequest{}
 
-		if err := json.NewDecoder(r.Body).Decode(&transferReq); err != nil {
-			return err
+	if err := json.NewDecoder(r.Body).Decode(&transferReq); err != nil {
+		return err
+	}
+
+	if transferReq.Amount <= 0 {
+		return fmt.Errorf("transfer amount must be greater than zero")
+	}
+
+	fromID, err := GetAccountIDFromContext(r)
+	if err != nil {
+		return err
+	}
+
+	if fromID == transferReq.ToAccount {
+		return fmt.Errorf("cannot transfer to the same account")
+	}
+
+	record, err := s.store.Transfer(fromID, transferReq.ToAccount, transferReq.Amount)
+	if err != nil {
+		if errors.Is(err, ErrInsufficientFunds) {
+			return WriteJSON(w, http.StatusUnprocessableEntity, APIError{Error: err.Error()})
 		}
 
-		return WriteJSON(w, http.StatusOK, transferReq)
+		return err
 	}
 
-	return fmt.Errorf("METHOD NOT ALLOWED %s", r.Method)
+	return WriteJSON(w, http.StatusOK, record)
+}
+
+func (s *APIServer) handleGetTransactions(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != "GET" {
+		return fmt.Errorf("METHOD NOT ALLOWED %s", r.Method)
+	}
+
+	id, err := getIdFromReq(r)
+	if err != nil {
+		return err
+	}
+
+	limit := 20
+	offset := 0
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+
+	records, err := s.store.GetLedgerByAccount(id, limit, offset)
+	if err != nil {
+		return fmt.Errorf("unable to get transactions for account %v", id)
+	}
+
+	return WriteJSON(w, http.StatusOK, records)
 }
 
 func getIdFromReq(r *http.Request) (int, error) {
@@ -210,8 +484,8 @@ func getIdFromReq(r *http.Request) (int, error) {
 	return id, nil
 }
 
-func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 8)
+func hashPassword(password string, cost int) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), cost)
 	return string(bytes), err
 }
 
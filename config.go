@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+type DatabaseConfig struct {
+	Host            string        `toml:"host"`
+	Port            int           `toml:"port"`
+	User            string        `toml:"user"`
+	Password        string        `toml:"password"`
+	DBName          string        `toml:"dbname"`
+	SSLMode         string        `toml:"sslmode"`
+	MaxOpenConns    int           `toml:"max_open_conns"`
+	MaxIdleConns    int           `toml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `toml:"conn_max_lifetime"`
+}
+
+type ServerConfig struct {
+	ListenAddr   string        `toml:"listen_addr"`
+	ReadTimeout  time.Duration `toml:"read_timeout"`
+	WriteTimeout time.Duration `toml:"write_timeout"`
+}
+
+type AuthConfig struct {
+	JWTSecret  string        `toml:"jwt_secret"`
+	AccessTTL  time.Duration `toml:"access_ttl"`
+	RefreshTTL time.Duration `toml:"refresh_ttl"`
+	BcryptCost int           `toml:"bcrypt_cost"`
+}
+
+type MailConfig struct {
+	Host     string `toml:"host"`
+	Port     string `toml:"port"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	From     string `toml:"from"`
+}
+
+type Config struct {
+	Database DatabaseConfig `toml:"database"`
+	Server   ServerConfig   `toml:"server"`
+	Auth     AuthConfig     `toml:"auth"`
+	Mail     MailConfig     `toml:"mail"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5432,
+			User:            "postgres",
+			Password:        "password",
+			DBName:          "postgres",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: time.Minute * 5,
+		},
+		Server: ServerConfig{
+			ListenAddr:   ":8000",
+			ReadTimeout:  time.Second * 15,
+			WriteTimeout: time.Second * 15,
+		},
+		Auth: AuthConfig{
+			AccessTTL:  time.Minute * 15,
+			RefreshTTL: time.Hour * 24 * 7,
+			BcryptCost: 8,
+		},
+	}
+}
+
+// LoadConfig reads path (falling back to the built-in defaults if it doesn't
+// exist), then applies any matching environment variable overrides. It fails
+// fast if the resulting config has no JWT secret, since nothing in the auth
+// flow is safe to run without one.
+func LoadConfig(path string) (*Config, error) {
+	cfg := defaultConfig()
+
+	if _, err := os.Stat(path); err == nil {
+		if _, err := toml.DecodeFile(path, &cfg); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+
+	applyEnvOverrides(&cfg)
+
+	if cfg.Auth.JWTSecret == "" {
+		return nil, fmt.Errorf("auth.jwt_secret must be set via config file or JWT_SECRET")
+	}
+
+	return &cfg, nil
+}
+
+func applyEnvOverrides(cfg *Config) {
+	if v := os.Getenv("DB_HOST"); v != "" {
+		cfg.Database.Host = v
+	}
+	if v := os.Getenv("DB_PORT"); v != "" {
+		if port, err := strconv.Atoi(v); err == nil {
+			cfg.Database.Port = port
+		}
+	}
+	if v := os.Getenv("DB_USER"); v != "" {
+		cfg.Database.User = v
+	}
+	if v := os.Getenv("DB_PASSWORD"); v != "" {
+		cfg.Database.Password = v
+	}
+	if v := os.Getenv("DB_NAME"); v != "" {
+		cfg.Database.DBName = v
+	}
+	if v := os.Getenv("DB_SSLMODE"); v != "" {
+		cfg.Database.SSLMode = v
+	}
+	if v := os.Getenv("DB_MAX_OPEN_CONNS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Database.MaxOpenConns = n
+		}
+	}
+	if v := os.Getenv("DB_MAX_IDLE_CONNS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Database.MaxIdleConns = n
+		}
+	}
+	if v := os.Getenv("DB_CONN_MAX_LIFETIME"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Database.ConnMaxLifetime = d
+		}
+	}
+
+	if v := os.Getenv("LISTEN_ADDR"); v != "" {
+		cfg.Server.ListenAddr = v
+	}
+	if v := os.Getenv("READ_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Server.ReadTimeout = d
+		}
+	}
+	if v := os.Getenv("WRITE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Server.WriteTimeout = d
+		}
+	}
+
+	if v := os.Getenv("JWT_SECRET"); v != "" {
+		cfg.Auth.JWTSecret = v
+	}
+	if v := os.Getenv("ACCESS_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Auth.AccessTTL = d
+		}
+	}
+	if v := os.Getenv("REFRESH_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.Auth.RefreshTTL = d
+		}
+	}
+	if v := os.Getenv("BCRYPT_COST"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Auth.BcryptCost = n
+		}
+	}
+
+	if v := os.Getenv("MAIL_HOST"); v != "" {
+		cfg.Mail.Host = v
+	}
+	if v := os.Getenv("MAIL_PORT"); v != "" {
+		cfg.Mail.Port = v
+	}
+	if v := os.Getenv("MAIL_USERNAME"); v != "" {
+		cfg.Mail.Username = v
+	}
+	if v := os.Getenv("MAIL_PASSWORD"); v != "" {
+		cfg.Mail.Password = v
+	}
+	if v := os.Getenv("MAIL_FROM"); v != "" {
+		cfg.Mail.From = v
+	}
+}
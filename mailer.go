@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+)
+
+// Mailer sends outbound transactional email, e.g. password reset links.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// LogMailer writes outgoing mail to the log instead of sending it, for local
+// development and tests where an SMTP server isn't available.
+type LogMailer struct{}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	log.Printf("mail to=%s subject=%q body=%q", to, subject, body)
+	return nil
+}
+
+// SMTPMailer sends mail through a real SMTP server using PLAIN auth.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	addr := fmt.Sprintf("%s:%s", m.Host, m.Port)
+	auth := smtp.PlainAuth("", m.Username, m.Password, m.Host)
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", m.From, to, subject, body)
+
+	return smtp.SendMail(addr, auth, m.From, []string{to}, []byte(msg))
+}
@@ -1,18 +1,78 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
 )
 
 func main() {
-	store, err := newPostgresStore()
+	configPath := flag.String("config", "./config.toml", "path to the TOML config file")
+	flag.Parse()
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("loading config %v", err)
+	}
+
+	store, err := newPostgresStore(cfg.Database)
 
 	if err != nil {
 		log.Fatalf("creating postgres store %v", err)
 	}
 
-	store.CreateAccountTable()
+	if err := store.Init(); err != nil {
+		log.Fatalf("initializing store %v", err)
+	}
+
+	if err := seedBootstrapAdmin(store, cfg.Auth); err != nil {
+		log.Fatalf("seeding bootstrap admin %v", err)
+	}
+
+	var mailer Mailer = &LogMailer{}
+	if cfg.Mail.Host != "" {
+		mailer = &SMTPMailer{
+			Host:     cfg.Mail.Host,
+			Port:     cfg.Mail.Port,
+			Username: cfg.Mail.Username,
+			Password: cfg.Mail.Password,
+			From:     cfg.Mail.From,
+		}
+	}
 
-	server := NewAPIServer(":8000", store)
+	server := NewAPIServer(cfg, store, mailer)
 	server.Run()
 }
+
+// seedBootstrapAdmin creates the first admin account from ADMIN_EMAIL and
+// ADMIN_PASSWORD when no admin account exists yet. It does nothing when
+// either variable is unset.
+func seedBootstrapAdmin(store Storage, authCfg AuthConfig) error {
+	email := os.Getenv("ADMIN_EMAIL")
+	password := os.Getenv("ADMIN_PASSWORD")
+
+	if email == "" || password == "" {
+		return nil
+	}
+
+	hasAdmin, err := store.HasAdminAccount()
+	if err != nil {
+		return err
+	}
+
+	if hasAdmin {
+		return nil
+	}
+
+	hashedPassword, err := hashPassword(password, authCfg.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	admin := NewAccount("Admin", "Admin", email, hashedPassword)
+	admin.Role = "admin"
+
+	_, err = store.CreateAccount(admin)
+
+	return err
+}
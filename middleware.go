@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const requestIDHeader = "X-Request-ID"
+const requestIDKey contextKey = "requestID"
+
+// statusRecorder wraps a ResponseWriter so middleware can observe the status
+// code and response size a handler produced.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+
+	return n, err
+}
+
+// WithRequestID reads X-Request-ID off the incoming request, generating one
+// if absent, and echoes it back on the response so callers can correlate logs.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if requestID == "" {
+			requestID = generateRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, requestID)
+
+		ctx := context.WithValue(r.Context(), requestIDKey, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func generateRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+// WithRecovery converts a panicking handler into a 500 response instead of
+// crashing the server, without leaking the stack trace to the client.
+func WithRecovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				slog.Error("panic recovered", "error", rec, "path", r.URL.Path)
+				WriteJSON(w, http.StatusInternalServerError, APIError{Error: "internal server error"})
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithLogging emits one structured log line per request via log/slog.
+func WithLogging(cfg AuthConfig) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+
+			next.ServeHTTP(rec, r)
+
+			requestID, _ := r.Context().Value(requestIDKey).(string)
+
+			attrs := []any{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rec.status,
+				"bytes", rec.bytes,
+				"duration_ms", time.Since(start).Milliseconds(),
+				"request_id", requestID,
+			}
+
+			if accountID, ok := actorIDFromRequest(r, cfg); ok {
+				attrs = append(attrs, "account_id", accountID)
+			}
+
+			slog.Info("request", attrs...)
+		})
+	}
+}
+
+// WithAudit appends {ts, actor_id, action, target_id, ip, ua, outcome} rows
+// to the audit_log table. When mutatingOnly is set, GET requests are skipped
+// since they don't change any state worth auditing.
+func WithAudit(store Storage, cfg AuthConfig, mutatingOnly bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if mutatingOnly && r.Method == "GET" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			actorID, _ := actorIDFromRequest(r, cfg)
+
+			var targetID *int
+			if idStr, ok := mux.Vars(r)["id"]; ok {
+				if id, err := strconv.Atoi(idStr); err == nil {
+					targetID = &id
+				}
+			}
+
+			outcome := "success"
+			if rec.status >= 400 {
+				outcome = "failure"
+			}
+
+			action := fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+
+			if err := store.RecordAuditLog(actorID, action, targetID, r.RemoteAddr, r.UserAgent(), outcome); err != nil {
+				slog.Error("audit log write failed", "error", err)
+			}
+		})
+	}
+}
+
+// actorIDFromRequest best-effort resolves the caller's account id straight
+// from the JWT, independent of whether the route behind it requires auth.
+func actorIDFromRequest(r *http.Request, cfg AuthConfig) (int, bool) {
+	tokenString := r.Header.Get("x-jwt-token")
+	if tokenString == "" {
+		return 0, false
+	}
+
+	token, err := ValidateJWT(tokenString, cfg)
+	if err != nil || !token.Valid {
+		return 0, false
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok {
+		return 0, false
+	}
+
+	return claims.AccountID, true
+}
@@ -1,16 +1,33 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+const uniqueViolation = "23505"
+const maxCreateAccountRetries = 5
+
+var ErrInsufficientFunds = errors.New("insufficient funds")
+var ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+var ErrPasswordResetInvalid = errors.New("password reset token is invalid, expired or already used")
+
+type contextKey string
+
+const claimsKey contextKey = "claims"
+
 type Storage interface {
 	CreateAccount(*Account) (*Account, error)
 	SignIn(email, password string) (*Account, error)
@@ -18,14 +35,32 @@ type Storage interface {
 	GetAccountById(int) (*Account, error)
 	UpdateAccount(*Account) error
 	DeleteAccount(int) error
+	Transfer(fromID, toID, amount int) (*TransferRecord, error)
+	GetLedgerByAccount(accountID, limit, offset int) ([]*TransferRecord, error)
+	HasAdminAccount() (bool, error)
+	RecordAuditLog(actorID int, action string, targetID *int, ip, ua, outcome string) error
+	CreateRefreshToken(accountID int, tokenHash, userAgent, ip string, expiresAt time.Time) (*RefreshToken, error)
+	GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error)
+	RevokeRefreshToken(id int, replacedBy *int) error
+	RevokeRefreshTokensByAccount(accountID int) error
+	ClaimRefreshToken(id int) (bool, error)
+	SetRefreshTokenReplacedBy(id, replacedBy int) error
+	GetAccountByEmail(email string) (*Account, error)
+	CreatePasswordReset(accountID int, tokenHash string, expiresAt time.Time) (*PasswordReset, error)
+	GetPasswordResetByHash(tokenHash string) (*PasswordReset, error)
+	MarkPasswordResetUsed(id int) error
+	UpdateAccountPassword(accountID int, hashedPassword string) error
 }
 
 type PostgresStore struct {
 	db *sql.DB
 }
 
-func newPostgresStore() (*PostgresStore, error) {
-	connStr := "user=postgres dbname=postgres password=password sslmode=disable"
+func newPostgresStore(cfg DatabaseConfig) (*PostgresStore, error) {
+	connStr := fmt.Sprintf(
+		"host=%s port=%d user=%s dbname=%s password=%s sslmode=%s",
+		cfg.Host, cfg.Port, cfg.User, cfg.DBName, cfg.Password, cfg.SSLMode,
+	)
 	db, err := sql.Open("postgres", connStr)
 
 	if err != nil {
@@ -36,13 +71,33 @@ func newPostgresStore() (*PostgresStore, error) {
 		return nil, err
 	}
 
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
 	return &PostgresStore{
 		db: db,
 	}, nil
 }
 
 func (s *PostgresStore) Init() error {
-	return s.CreateAccountTable()
+	if err := s.CreateAccountTable(); err != nil {
+		return err
+	}
+
+	if err := s.CreateLedgerTable(); err != nil {
+		return err
+	}
+
+	if err := s.CreateRefreshTokenTable(); err != nil {
+		return err
+	}
+
+	if err := s.CreatePasswordResetTable(); err != nil {
+		return err
+	}
+
+	return s.CreateAuditLogTable()
 }
 
 func (s *PostgresStore) CreateAccountTable() error {
@@ -54,8 +109,62 @@ func (s *PostgresStore) CreateAccountTable() error {
 		last_name varchar(48),
 		email varchar(64) UNIQUE,
 		password varchar(256) NOT NULL ,
-		account_number int UNIQUE,
-		balance int
+		account_number bigint UNIQUE,
+		balance bigint NOT NULL DEFAULT 0,
+		role varchar(16) NOT NULL DEFAULT 'user'
+	);`
+
+	_, err := s.db.Exec(query)
+
+	return err
+}
+
+func (s *PostgresStore) CreateLedgerTable() error {
+	query := `--sql
+	CREATE TABLE IF NOT EXISTS ledger(
+		id serial primary key,
+		from_account int REFERENCES account(id),
+		to_account int REFERENCES account(id),
+		amount bigint NOT NULL,
+		created_at timestamp,
+		status varchar(16) NOT NULL
+	);`
+
+	_, err := s.db.Exec(query)
+
+	return err
+}
+
+func (s *PostgresStore) CreateRefreshTokenTable() error {
+	query := `--sql
+	CREATE TABLE IF NOT EXISTS refresh_tokens(
+		id serial primary key,
+		account_id int REFERENCES account(id),
+		token_hash varchar(64) UNIQUE NOT NULL,
+		expires_at timestamp NOT NULL,
+		revoked_at timestamp,
+		replaced_by int REFERENCES refresh_tokens(id),
+		user_agent varchar(256),
+		ip varchar(64),
+		created_at timestamp NOT NULL
+	);`
+
+	_, err := s.db.Exec(query)
+
+	return err
+}
+
+func (s *PostgresStore) CreateAuditLogTable() error {
+	query := `--sql
+	CREATE TABLE IF NOT EXISTS audit_log(
+		id serial primary key,
+		ts timestamp NOT NULL,
+		actor_id int,
+		action varchar(128) NOT NULL,
+		target_id int,
+		ip varchar(64),
+		ua varchar(256),
+		outcome varchar(16) NOT NULL
 	);`
 
 	_, err := s.db.Exec(query)
@@ -63,28 +172,115 @@ func (s *PostgresStore) CreateAccountTable() error {
 	return err
 }
 
+func (s *PostgresStore) CreatePasswordResetTable() error {
+	query := `--sql
+	CREATE TABLE IF NOT EXISTS password_resets(
+		id serial primary key,
+		account_id int REFERENCES account(id),
+		token_hash varchar(64) UNIQUE NOT NULL,
+		expires_at timestamp NOT NULL,
+		used_at timestamp,
+		created_at timestamp NOT NULL
+	);`
+
+	_, err := s.db.Exec(query)
+
+	return err
+}
+
+// CreateAccount assigns the account a fresh bank number and zero balance,
+// retrying on a unique_violation of account_number up to
+// maxCreateAccountRetries times before giving up.
 func (s *PostgresStore) CreateAccount(account *Account) (*Account, error) {
 	query := `--sql
-	INSERT INTO account(first_name, last_name, email, password, account_number, balance, created_at)
-	values($1, $2, $3, $4, $5, $6, $7)
-	RETURNING created_at, id, first_name, last_name, email, account_number, balance;
+	INSERT INTO account(first_name, last_name, email, password, account_number, balance, role, created_at)
+	values($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING created_at, id, first_name, last_name, email, password, account_number, balance, role;
 	`
-	rows, err := s.db.Query(
-		query,
-		account.FirstName,
-		account.LastName,
-		account.Email,
-		account.Password,
-		account.BankNumber,
-		account.Balance,
-		account.CreatedAt,
-	)
 
-	if err != nil {
-		return nil, err
+	account.Balance = 0
+
+	var lastErr error
+	for attempt := 0; attempt < maxCreateAccountRetries; attempt++ {
+		bankNumber, err := generateBankNumber()
+		if err != nil {
+			return nil, err
+		}
+		account.BankNumber = bankNumber
+
+		rows, err := s.db.Query(
+			query,
+			account.FirstName,
+			account.LastName,
+			account.Email,
+			account.Password,
+			account.BankNumber,
+			account.Balance,
+			account.Role,
+			account.CreatedAt,
+		)
+		if err == nil {
+			return rowToAccount(rows)
+		}
+
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) || pqErr.Code != uniqueViolation || pqErr.Constraint != "account_account_number_key" {
+			return nil, err
+		}
+
+		lastErr = err
 	}
 
-	return rowToAccount(rows)
+	return nil, fmt.Errorf("generating unique bank number after %d attempts: %w", maxCreateAccountRetries, lastErr)
+}
+
+// generateBankNumber draws 15 random digits from crypto/rand and appends a
+// Luhn check digit, giving a 16-digit account number that isn't guessable
+// from a predictable RNG seed. All 15 digits are drawn again if the leading
+// digit comes up 0, since a leading zero would leave fewer than 16 significant
+// digits once the number is stored as a bare integer.
+func generateBankNumber() (int64, error) {
+	const digits = 15
+
+	buf := make([]byte, digits)
+	for {
+		if _, err := rand.Read(buf); err != nil {
+			return 0, err
+		}
+
+		if buf[0]%10 != 0 {
+			break
+		}
+	}
+
+	var number int64
+	for _, b := range buf {
+		number = number*10 + int64(b)%10
+	}
+
+	return number*10 + luhnCheckDigit(number), nil
+}
+
+// luhnCheckDigit computes the Luhn check digit for number, treating it as
+// the payload digits read left to right.
+func luhnCheckDigit(number int64) int64 {
+	digits := []int64{}
+	for n := number; n > 0; n /= 10 {
+		digits = append(digits, n%10)
+	}
+
+	var sum int64
+	for i, d := range digits {
+		if i%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+
+	return (10 - sum%10) % 10
 }
 
 func (s *PostgresStore) SignIn(email, password string) (*Account, error) {
@@ -100,10 +296,31 @@ func (s *PostgresStore) SignIn(email, password string) (*Account, error) {
 	return rowToAccount(rows)
 }
 
+func (s *PostgresStore) GetAccountByEmail(email string) (*Account, error) {
+	query := `--sql
+	SELECT * FROM account WHERE email=$1;
+	`
+	rows, err := s.db.Query(query, email)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rowToAccount(rows)
+}
+
 func (s *PostgresStore) UpdateAccount(*Account) error {
 	return nil
 }
 
+func (s *PostgresStore) UpdateAccountPassword(accountID int, hashedPassword string) error {
+	query := `--sql UPDATE account SET password=$1 WHERE id=$2;`
+
+	_, err := s.db.Exec(query, hashedPassword, accountID)
+
+	return err
+}
+
 func (s *PostgresStore) DeleteAccount(id int) error {
 	query := `--sql DELETE FROM account WHERE id=$1;`
 
@@ -116,53 +333,448 @@ func (s *PostgresStore) DeleteAccount(id int) error {
 	return nil
 }
 
+func (s *PostgresStore) Transfer(fromID, toID, amount int) (*TransferRecord, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock both rows up front in a fixed (ascending id) order so two transfers
+	// running in opposite directions (A->B and B->A) can never take these
+	// locks in reverse order and deadlock.
+	firstID, secondID := fromID, toID
+	if secondID < firstID {
+		firstID, secondID = secondID, firstID
+	}
+
+	balances := map[int]int{}
+	rows, err := tx.Query(`SELECT id, balance FROM account WHERE id IN ($1, $2) ORDER BY id FOR UPDATE`, firstID, secondID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id, balance int
+		if err := rows.Scan(&id, &balance); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		balances[id] = balance
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	fromBalance, ok := balances[fromID]
+	if !ok {
+		return nil, fmt.Errorf("source account %v not found", fromID)
+	}
+	if _, ok := balances[toID]; !ok {
+		return nil, fmt.Errorf("destination account %v not found", toID)
+	}
+
+	if fromBalance < amount {
+		return nil, ErrInsufficientFunds
+	}
+
+	if _, err := tx.Exec(`UPDATE account SET balance = balance - $1 WHERE id=$2`, amount, fromID); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`UPDATE account SET balance = balance + $1 WHERE id=$2`, amount, toID); err != nil {
+		return nil, err
+	}
+
+	query := `--sql
+	INSERT INTO ledger(from_account, to_account, amount, created_at, status)
+	VALUES ($1, $2, $3, $4, 'completed')
+	RETURNING id, from_account, to_account, amount, created_at, status;
+	`
+	record := &TransferRecord{}
+	err = tx.QueryRow(query, fromID, toID, amount, time.Now().UTC()).Scan(
+		&record.ID,
+		&record.FromAccount,
+		&record.ToAccount,
+		&record.Amount,
+		&record.CreatedAt,
+		&record.Status,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (s *PostgresStore) GetLedgerByAccount(accountID, limit, offset int) ([]*TransferRecord, error) {
+	query := `--sql
+	SELECT id, from_account, to_account, amount, created_at, status FROM ledger
+	WHERE from_account=$1 OR to_account=$1
+	ORDER BY created_at DESC
+	LIMIT $2 OFFSET $3;
+	`
+	rows, err := s.db.Query(query, accountID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []*TransferRecord{}
+	for rows.Next() {
+		record := &TransferRecord{}
+		err := rows.Scan(
+			&record.ID,
+			&record.FromAccount,
+			&record.ToAccount,
+			&record.Amount,
+			&record.CreatedAt,
+			&record.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func (s *PostgresStore) CreateRefreshToken(accountID int, tokenHash, userAgent, ip string, expiresAt time.Time) (*RefreshToken, error) {
+	query := `--sql
+	INSERT INTO refresh_tokens(account_id, token_hash, expires_at, user_agent, ip, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, account_id, token_hash, expires_at, revoked_at, replaced_by, user_agent, ip, created_at;
+	`
+
+	refreshToken := &RefreshToken{}
+	err := s.db.QueryRow(query, accountID, tokenHash, expiresAt, userAgent, ip, time.Now().UTC()).Scan(
+		&refreshToken.ID,
+		&refreshToken.AccountID,
+		&refreshToken.TokenHash,
+		&refreshToken.ExpiresAt,
+		&refreshToken.RevokedAt,
+		&refreshToken.ReplacedBy,
+		&refreshToken.UserAgent,
+		&refreshToken.IP,
+		&refreshToken.CreatedAt,
+	)
+
+	return refreshToken, err
+}
+
+func (s *PostgresStore) GetRefreshTokenByHash(tokenHash string) (*RefreshToken, error) {
+	query := `--sql
+	SELECT id, account_id, token_hash, expires_at, revoked_at, replaced_by, user_agent, ip, created_at
+	FROM refresh_tokens WHERE token_hash=$1;
+	`
+
+	refreshToken := &RefreshToken{}
+	err := s.db.QueryRow(query, tokenHash).Scan(
+		&refreshToken.ID,
+		&refreshToken.AccountID,
+		&refreshToken.TokenHash,
+		&refreshToken.ExpiresAt,
+		&refreshToken.RevokedAt,
+		&refreshToken.ReplacedBy,
+		&refreshToken.UserAgent,
+		&refreshToken.IP,
+		&refreshToken.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return refreshToken, nil
+}
+
+func (s *PostgresStore) RevokeRefreshToken(id int, replacedBy *int) error {
+	query := `--sql
+	UPDATE refresh_tokens SET revoked_at=$1, replaced_by=$2 WHERE id=$3;
+	`
+
+	_, err := s.db.Exec(query, time.Now().UTC(), replacedBy, id)
+
+	return err
+}
+
+// ClaimRefreshToken atomically marks a refresh token revoked only if it is
+// still live, so two concurrent requests replaying the same token can't both
+// pass the revoked_at check and mint a successor pair.
+func (s *PostgresStore) ClaimRefreshToken(id int) (bool, error) {
+	query := `--sql
+	UPDATE refresh_tokens SET revoked_at=$1 WHERE id=$2 AND revoked_at IS NULL RETURNING id;
+	`
+
+	var claimedID int
+	err := s.db.QueryRow(query, time.Now().UTC(), id).Scan(&claimedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *PostgresStore) SetRefreshTokenReplacedBy(id, replacedBy int) error {
+	query := `--sql
+	UPDATE refresh_tokens SET replaced_by=$1 WHERE id=$2;
+	`
+
+	_, err := s.db.Exec(query, replacedBy, id)
+
+	return err
+}
+
+func (s *PostgresStore) RevokeRefreshTokensByAccount(accountID int) error {
+	query := `--sql
+	UPDATE refresh_tokens SET revoked_at=$1 WHERE account_id=$2 AND revoked_at IS NULL;
+	`
+
+	_, err := s.db.Exec(query, time.Now().UTC(), accountID)
+
+	return err
+}
+
+func (s *PostgresStore) CreatePasswordReset(accountID int, tokenHash string, expiresAt time.Time) (*PasswordReset, error) {
+	query := `--sql
+	INSERT INTO password_resets(account_id, token_hash, expires_at, created_at)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, account_id, token_hash, expires_at, used_at, created_at;
+	`
+
+	reset := &PasswordReset{}
+	err := s.db.QueryRow(query, accountID, tokenHash, expiresAt, time.Now().UTC()).Scan(
+		&reset.ID,
+		&reset.AccountID,
+		&reset.TokenHash,
+		&reset.ExpiresAt,
+		&reset.UsedAt,
+		&reset.CreatedAt,
+	)
+
+	return reset, err
+}
+
+func (s *PostgresStore) GetPasswordResetByHash(tokenHash string) (*PasswordReset, error) {
+	query := `--sql
+	SELECT id, account_id, token_hash, expires_at, used_at, created_at
+	FROM password_resets WHERE token_hash=$1;
+	`
+
+	reset := &PasswordReset{}
+	err := s.db.QueryRow(query, tokenHash).Scan(
+		&reset.ID,
+		&reset.AccountID,
+		&reset.TokenHash,
+		&reset.ExpiresAt,
+		&reset.UsedAt,
+		&reset.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPasswordResetInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return reset, nil
+}
+
+func (s *PostgresStore) MarkPasswordResetUsed(id int) error {
+	query := `--sql UPDATE password_resets SET used_at=$1 WHERE id=$2;`
+
+	_, err := s.db.Exec(query, time.Now().UTC(), id)
+
+	return err
+}
+
+func (s *PostgresStore) RecordAuditLog(actorID int, action string, targetID *int, ip, ua, outcome string) error {
+	query := `--sql
+	INSERT INTO audit_log(ts, actor_id, action, target_id, ip, ua, outcome)
+	VALUES ($1, $2, $3, $4, $5, $6, $7);
+	`
+
+	_, err := s.db.Exec(query, time.Now().UTC(), actorID, action, targetID, ip, ua, outcome)
+
+	return err
+}
+
+func (s *PostgresStore) HasAdminAccount() (bool, error) {
+	var exists bool
+
+	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM account WHERE role='admin')`).Scan(&exists)
+
+	return exists, err
+}
+
 func permissionDenied(w http.ResponseWriter) {
 	WriteJSON(w, http.StatusForbidden, APIError{Error: "Permission Denied"})
 }
 
-func WithJWTAuth(handler http.HandlerFunc, s Storage) http.HandlerFunc {
+func WithJWTAuth(handler http.HandlerFunc, s Storage, cfg AuthConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		tokenString := r.Header.Get("x-jwt-token")
 
-		token, err := ValidateJWT(tokenString)
-		fmt.Print(err)
-		if err != nil {
+		token, err := ValidateJWT(tokenString, cfg)
+		if err != nil || !token.Valid {
 			permissionDenied(w)
 			return
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		userId := int(claims["id"].(float64))
+		claims, ok := token.Claims.(*Claims)
+		if !ok {
+			permissionDenied(w)
+			return
+		}
 
-		if _, err = s.GetAccountById(userId); err != nil {
+		if _, err = s.GetAccountById(claims.AccountID); err != nil {
 			permissionDenied(w)
 			return
 		}
 
-		handler(w, r)
+		ctx := context.WithValue(r.Context(), claimsKey, claims)
+		handler(w, r.WithContext(ctx))
+	}
+}
+
+// RequireRole only lets requests through whose JWT claims carry the given role.
+func RequireRole(role string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, err := GetClaimsFromContext(r)
+			if err != nil || claims.Role != role {
+				permissionDenied(w)
+				return
+			}
+
+			handler(w, r)
+		}
+	}
+}
+
+// RequireSelfOrAdmin only lets a request through if the caller owns the
+// {id} in the URL or holds the admin role.
+func RequireSelfOrAdmin() func(http.HandlerFunc) http.HandlerFunc {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, err := GetClaimsFromContext(r)
+			if err != nil {
+				permissionDenied(w)
+				return
+			}
+
+			if claims.Role == "admin" {
+				handler(w, r)
+				return
+			}
+
+			id, err := getIdFromReq(r)
+			if err != nil || id != claims.AccountID {
+				permissionDenied(w)
+				return
+			}
+
+			handler(w, r)
+		}
+	}
+}
+
+func GetClaimsFromContext(r *http.Request) (*Claims, error) {
+	claims, ok := r.Context().Value(claimsKey).(*Claims)
+	if !ok {
+		return nil, fmt.Errorf("claims not found in request context")
 	}
+
+	return claims, nil
 }
 
-func CreateJWTToken(account *Account) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
+func GetAccountIDFromContext(r *http.Request) (int, error) {
+	claims, err := GetClaimsFromContext(r)
+	if err != nil {
+		return 0, err
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"id":  account.ID,
-			"exp": time.Now().Add(time.Hour * 24).Unix(),
-		})
+	return claims.AccountID, nil
+}
 
-	return token.SignedString([]byte(secret))
+type Claims struct {
+	AccountID int    `json:"id"`
+	Role      string `json:"role"`
+	jwt.RegisteredClaims
 }
 
-func ValidateJWT(tokenString string) (*jwt.Token, error) {
-	secret := os.Getenv("JWT_SECRET")
+func CreateJWTToken(account *Account, cfg AuthConfig) (string, error) {
+	claims := &Claims{
+		AccountID: account.ID,
+		Role:      account.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(cfg.AccessTTL)),
+		},
+	}
 
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+
+	return token.SignedString([]byte(cfg.JWTSecret))
+}
+
+func ValidateJWT(tokenString string, cfg AuthConfig) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(cfg.JWTSecret), nil
 	})
 }
 
+const passwordResetTTL = time.Minute * 30
+
+// generateOpaqueToken returns a random URL-safe token alongside its SHA-256
+// hash, so only the hash is ever persisted and the plaintext value can't be
+// recovered from the database.
+func generateOpaqueToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+
+	token = base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(buf)
+
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueTokenPair creates a fresh access/refresh token pair for account and
+// persists the refresh token so it can be rotated or revoked later.
+func IssueTokenPair(s Storage, account *Account, userAgent, ip string, cfg AuthConfig) (accessToken, refreshToken string, err error) {
+	accessToken, err = CreateJWTToken(account, cfg)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, hash, err := generateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	if _, err := s.CreateRefreshToken(account.ID, hash, userAgent, ip, time.Now().UTC().Add(cfg.RefreshTTL)); err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
 func (s *PostgresStore) GetAccounts() ([]*Account, error) {
 	rows, err := s.db.Query(`SELECT * FROM account`)
 
@@ -198,6 +810,7 @@ func rowToAccount(rows *sql.Rows) (*Account, error) {
 		&account.Password,
 		&account.BankNumber,
 		&account.Balance,
+		&account.Role,
 	)
 	return account, err
 }
@@ -212,8 +825,11 @@ func rowsToAccounts(rows *sql.Rows) ([]*Account, error) {
 			&account.ID,
 			&account.FirstName,
 			&account.LastName,
+			&account.Email,
+			&account.Password,
 			&account.BankNumber,
 			&account.Balance,
+			&account.Role,
 		)
 
 		if err != nil {
@@ -1,9 +1,6 @@
 package main
 
-import (
-	"math/rand"
-	"time"
-)
+import "time"
 
 type SignUpRequest struct {
 	FirstName       string `json:"first_name"`
@@ -23,6 +20,55 @@ type TransferRequest struct {
 	Amount    int `json:"amount"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token           string `json:"token"`
+	NewPassword     string `json:"new_password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+type PasswordReset struct {
+	ID        int        `json:"id"`
+	AccountID int        `json:"account_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RefreshToken struct {
+	ID         int        `json:"id"`
+	AccountID  int        `json:"account_id"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	ReplacedBy *int       `json:"replaced_by,omitempty"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type TransferRecord struct {
+	ID          int       `json:"id"`
+	FromAccount int       `json:"from_account"`
+	ToAccount   int       `json:"to_account"`
+	Amount      int       `json:"amount"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
 type Account struct {
 	ID         int       `json:"id"`
 	FirstName  string    `json:"first_name"`
@@ -31,17 +77,20 @@ type Account struct {
 	Password   string    `json:"password"`
 	BankNumber int64     `json:"bank_number"`
 	Balance    int       `json:"balance"`
+	Role       string    `json:"role"`
 	CreatedAt  time.Time `json:"created_at"`
 }
 
+// NewAccount builds an Account from user-supplied fields only. BankNumber and
+// Balance are assigned by the store layer on creation, not here, so tests can
+// construct deterministic Account values.
 func NewAccount(FirstName, LastName, Email, Password string) *Account {
 	return &Account{
-		FirstName:  FirstName,
-		LastName:   LastName,
-		Email:      Email,
-		Password:   Password,
-		BankNumber: int64(rand.Intn(1000000)),
-		Balance:    0,
-		CreatedAt:  time.Now().UTC(),
+		FirstName: FirstName,
+		LastName:  LastName,
+		Email:     Email,
+		Password:  Password,
+		Role:      "user",
+		CreatedAt: time.Now().UTC(),
 	}
 }